@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultCAdvisorAddr = "http://localhost:8080"
+	cadvisorPollPeriod  = 5 * time.Second
+)
+
+// errNoCadvisorData is returned by fetch when cAdvisor responds with an
+// empty subcontainers list, e.g. for a container it hasn't indexed yet.
+var errNoCadvisorData = errors.New("cadvisor: no data for container")
+
+// cadvisorContainerInfo is the subset of cAdvisor's ContainerInfo we need,
+// as returned by GET /api/v1.3/subcontainers/<cgroup path>.
+type cadvisorContainerInfo struct {
+	Spec struct {
+		Memory struct {
+			Limit float64 `json:"limit"`
+		} `json:"memory"`
+	} `json:"spec"`
+	Stats []struct {
+		Timestamp time.Time `json:"timestamp"`
+		Cpu       struct {
+			Usage struct {
+				Total float64 `json:"total"`
+			} `json:"usage"`
+		} `json:"cpu"`
+		Memory struct {
+			Usage float64 `json:"usage"`
+		} `json:"memory"`
+		Network struct {
+			RxBytes float64 `json:"rx_bytes"`
+			TxBytes float64 `json:"tx_bytes"`
+		} `json:"network"`
+		DiskIo struct {
+			IoServiceBytes []struct {
+				Stats struct {
+					Read  float64 `json:"Read"`
+					Write float64 `json:"Write"`
+				} `json:"stats"`
+			} `json:"io_service_bytes"`
+		} `json:"diskio"`
+	} `json:"stats"`
+}
+
+// cadvisorSource reads per-container stats from cAdvisor's subcontainers
+// API, mapping a Docker container ID to the cgroup path cAdvisor exposes it
+// under (/docker/<id>). This is a second fallback for environments that run
+// cAdvisor but not the controller API.
+type cadvisorSource struct {
+	addr   string
+	client *http.Client
+}
+
+func newCAdvisorSource(addr string) *cadvisorSource {
+	if addr == "" {
+		addr = defaultCAdvisorAddr
+	}
+	return &cadvisorSource{
+		addr:   addr,
+		client: &http.Client{},
+	}
+}
+
+func (s *cadvisorSource) Stream(ctx context.Context, cid string) (<-chan Sample, error) {
+	out := make(chan Sample)
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(cadvisorPollPeriod)
+		defer ticker.Stop()
+
+		var lastCpu, lastRx, lastTx, lastRead, lastWrite, lastTs float64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := s.fetch(ctx, cid)
+			if err != nil || len(info.Stats) == 0 {
+				continue
+			}
+			latest := info.Stats[len(info.Stats)-1]
+			ts := float64(latest.Timestamp.UnixNano())
+
+			var read, write float64
+			for _, d := range latest.DiskIo.IoServiceBytes {
+				read += d.Stats.Read
+				write += d.Stats.Write
+			}
+
+			if lastTs == 0 {
+				lastCpu, lastRx, lastTx, lastRead, lastWrite, lastTs =
+					latest.Cpu.Usage.Total, latest.Network.RxBytes, latest.Network.TxBytes, read, write, ts
+				continue
+			}
+
+			elapsedSeconds := (ts - lastTs) / 1e9
+			sample := Sample{CID: cid, Timestamp: latest.Timestamp}
+			if elapsedSeconds > 0 {
+				sample.CPUPercent = (latest.Cpu.Usage.Total - lastCpu) / elapsedSeconds / 1e7
+				sample.NetRxBps = (latest.Network.RxBytes - lastRx) / elapsedSeconds
+				sample.NetTxBps = (latest.Network.TxBytes - lastTx) / elapsedSeconds
+				sample.BlkReadBps = (read - lastRead) / elapsedSeconds
+				sample.BlkWriteBps = (write - lastWrite) / elapsedSeconds
+			}
+			sample.MemoryUsageBytes = latest.Memory.Usage
+			if info.Spec.Memory.Limit > 0 {
+				sample.MemPercent = latest.Memory.Usage / info.Spec.Memory.Limit * 100
+			}
+			lastCpu, lastRx, lastTx, lastRead, lastWrite, lastTs =
+				latest.Cpu.Usage.Total, latest.Network.RxBytes, latest.Network.TxBytes, read, write, ts
+
+			select {
+			case out <- sample:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *cadvisorSource) fetch(ctx context.Context, cid string) (*cadvisorContainerInfo, error) {
+	url := s.addr + "/api/v1.3/subcontainers/docker/" + cid
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var infos []cadvisorContainerInfo
+	if err := json.NewDecoder(res.Body).Decode(&infos); err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, errNoCadvisorData
+	}
+	return &infos[0], nil
+}
+
+func (s *cadvisorSource) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
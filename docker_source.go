@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// dockerEngineSource reads per-container stats directly from the Docker
+// Engine API over its UNIX socket, so the autoscaler keeps working in
+// environments where the controller API isn't deployed. It speaks the same
+// streaming JSON envelope the Docker CLI's stats helpers consume from
+// GET /containers/{id}/stats.
+type dockerEngineSource struct {
+	client *http.Client
+}
+
+func newDockerEngineSource(socket string) *dockerEngineSource {
+	if socket == "" {
+		socket = defaultDockerSocket
+	}
+	return &dockerEngineSource{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func (s *dockerEngineSource) Stream(ctx context.Context, cid string) (<-chan Sample, error) {
+	req, err := http.NewRequest("GET", "http://docker/containers/"+cid+"/stats?stream=1", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Sample)
+	go func() {
+		defer close(out)
+		defer res.Body.Close()
+
+		dec := json.NewDecoder(res.Body)
+		var last *Stat
+		var lastAt time.Time
+		for {
+			stat := &Stat{}
+			if err := dec.Decode(stat); err != nil {
+				return
+			}
+			now := time.Now()
+
+			if last == nil {
+				last, lastAt = stat, now
+				continue
+			}
+
+			sample := deriveSample(cid, last, stat, now.Sub(lastAt).Seconds(), now)
+			last, lastAt = stat, now
+
+			select {
+			case out <- sample:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *dockerEngineSource) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	defaultEWMAHalfLife = 30 * time.Second
+
+	// ewmaHistorySize bounds how many recent EWMA values the slope
+	// predictor fits a line against.
+	ewmaHistorySize = 5
+)
+
+// ewmaPoint is one (time, value) pair kept for the slope fit.
+type ewmaPoint struct {
+	at    time.Time
+	value float64
+}
+
+// ewmaTracker maintains an exponentially-weighted moving average with a
+// configurable half-life, plus a short history used to fit a linear trend.
+// It tolerates the irregular sampling intervals a MetricsSource may produce.
+type ewmaTracker struct {
+	halfLife time.Duration
+	value    float64
+	set      bool
+	history  []ewmaPoint
+}
+
+func newEWMATracker(halfLife time.Duration) *ewmaTracker {
+	if halfLife <= 0 {
+		halfLife = defaultEWMAHalfLife
+	}
+	return &ewmaTracker{halfLife: halfLife}
+}
+
+// update folds sample (taken at at) into the moving average and returns the
+// new average along with the fitted slope (units per second) over the
+// recent history. A sample taken no later than the previous one leaves the
+// average unchanged.
+func (e *ewmaTracker) update(at time.Time, sample float64) (value, slope float64) {
+	if !e.set {
+		e.value = sample
+		e.set = true
+	} else if last := e.history[len(e.history)-1]; at.After(last.at) {
+		dt := at.Sub(last.at).Seconds()
+		alpha := 1 - math.Exp(-math.Ln2*dt/e.halfLife.Seconds())
+		e.value += alpha * (sample - e.value)
+	}
+
+	e.history = append(e.history, ewmaPoint{at: at, value: e.value})
+	if len(e.history) > ewmaHistorySize {
+		e.history = e.history[len(e.history)-ewmaHistorySize:]
+	}
+	return e.value, e.slope()
+}
+
+// slope fits a line to the tracked history by least squares and returns its
+// slope, or 0 if there isn't enough history yet.
+func (e *ewmaTracker) slope() float64 {
+	n := len(e.history)
+	if n < 2 {
+		return 0
+	}
+
+	t0 := e.history[0].at
+	var sumT, sumV, sumTT, sumTV float64
+	for _, p := range e.history {
+		t := p.at.Sub(t0).Seconds()
+		sumT += t
+		sumV += p.value
+		sumTT += t * t
+		sumTV += t * p.value
+	}
+
+	nf := float64(n)
+	denom := nf*sumTT - sumT*sumT
+	if denom == 0 {
+		return 0
+	}
+	return (nf*sumTV - sumT*sumV) / denom
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event is one scaling decision, successful or not, including no-ops so
+// operators can see why the autoscaler chose not to act.
+type Event struct {
+	App     string    `json:"app"`
+	Service string    `json:"service"`
+	Action  string    `json:"action"` // "scale_out", "scale_in", or "noop"
+	Reason  string    `json:"reason"`
+	From    int       `json:"from,omitempty"`
+	To      int       `json:"to,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Broker fans scale decision Events out to any number of /events
+// subscribers.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[chan Event]bool
+}
+
+// NewBroker returns an empty Broker ready to Publish to and Subscribe from.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan Event]bool)}
+}
+
+// Publish fans out e to every current subscriber. A subscriber whose buffer
+// is full misses e rather than blocking the caller; it stays subscribed.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (b *Broker) subscribe() chan Event {
+	ch := make(chan Event, 16)
+	b.mu.Lock()
+	b.subs[ch] = true
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *Broker) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+// ServeHTTP streams Events as Server-Sent Events until the client
+// disconnects.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := b.subscribe()
+	defer b.unsubscribe(ch)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package metrics exposes the autoscaler's internal state to operators: a
+// Prometheus /metrics endpoint and a /events Server-Sent Events stream of
+// scale decisions.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ContainerCPU = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscale_container_cpu_percent",
+		Help: "CPU usage percent of a single container, as last sampled.",
+	}, []string{"app", "service", "container_id"})
+
+	ContainerMemory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscale_container_memory_percent",
+		Help: "Memory usage as a percent of limit for a single container, as last sampled.",
+	}, []string{"app", "service", "container_id"})
+
+	GroupAverageCPU = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscale_group_avg_cpu_percent",
+		Help: "Average CPU usage percent across a group's containers.",
+	}, []string{"app", "service"})
+
+	GroupAverageMemory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscale_group_avg_memory_percent",
+		Help: "Average memory usage percent across a group's containers.",
+	}, []string{"app", "service"})
+
+	Replicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscale_replicas",
+		Help: "Current number of containers running in a group.",
+	}, []string{"app", "service"})
+
+	ScaleOutTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "autoscale_scale_out_total",
+		Help: "Number of successful scale-out actions.",
+	}, []string{"app", "service"})
+
+	ScaleInTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "autoscale_scale_in_total",
+		Help: "Number of successful scale-in actions.",
+	}, []string{"app", "service"})
+
+	ScaleErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "autoscale_scale_errors_total",
+		Help: "Number of scale actions that failed.",
+	}, []string{"app", "service"})
+
+	DecisionLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "autoscale_decision_loop_seconds",
+		Help:    "Time taken to evaluate one scaling decision loop iteration.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"app", "service"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		ContainerCPU,
+		ContainerMemory,
+		GroupAverageCPU,
+		GroupAverageMemory,
+		Replicas,
+		ScaleOutTotal,
+		ScaleInTotal,
+		ScaleErrorsTotal,
+		DecisionLatency,
+	)
+}
+
+// EvictContainer removes a container's per-container gauges once it stops
+// being watched, so stale series don't linger after a scale-in.
+func EvictContainer(app, service, cid string) {
+	ContainerCPU.DeleteLabelValues(app, service, cid)
+	ContainerMemory.DeleteLabelValues(app, service, cid)
+}
@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewServer builds the embedded HTTP server that exposes /metrics in
+// Prometheus text format and /events as an SSE stream of scale decisions.
+// It does not call ListenAndServe; the caller controls the server's
+// lifecycle (e.g. to shut it down alongside the rest of the process).
+func NewServer(addr string, broker *Broker) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/events", broker)
+
+	return &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sample is a single point-in-time reading for one container, in the same
+// fields whichever MetricsSource produced it.
+type Sample struct {
+	CID string
+
+	// CPUPercent's scale depends on the source: the controller and docker
+	// sources report a share of the host's total CPU time across all cores,
+	// while the cadvisor source reports usage relative to one core, so one
+	// fully busy core reads 100.
+	CPUPercent float64
+	MemPercent float64
+
+	// MemoryUsageBytes is the raw memory usage backing MemPercent. It's kept
+	// alongside the percentage so AutoScaleGroup.MemoryHigh/MemoryLow, which
+	// predate mem_pct and are expressed in bytes, can still be compared
+	// against it.
+	MemoryUsageBytes float64
+
+	NetRxBps float64
+	NetTxBps float64
+
+	BlkReadBps  float64
+	BlkWriteBps float64
+
+	Timestamp time.Time
+}
+
+// deriveSample turns two consecutive raw Stat readings, taken elapsed
+// seconds apart, into a Sample of rates. prev is the earlier reading.
+func deriveSample(cid string, prev, cur *Stat, elapsed float64, at time.Time) Sample {
+	s := Sample{
+		CID:              cid,
+		CPUPercent:       cpuPercent(prev, cur),
+		MemPercent:       cur.memPercent(),
+		MemoryUsageBytes: cur.MemoryStats.Usage,
+		Timestamp:        at,
+	}
+	if elapsed <= 0 {
+		return s
+	}
+
+	prevRx, prevTx := prev.networkTotals()
+	curRx, curTx := cur.networkTotals()
+	s.NetRxBps = (curRx - prevRx) / elapsed
+	s.NetTxBps = (curTx - prevTx) / elapsed
+
+	prevRead, prevWrite := prev.blkioTotals()
+	curRead, curWrite := cur.blkioTotals()
+	s.BlkReadBps = (curRead - prevRead) / elapsed
+	s.BlkWriteBps = (curWrite - prevWrite) / elapsed
+
+	return s
+}
+
+// MetricsSource streams Samples for a single container. Implementations may
+// be backed by the controller API, a local daemon, or anything else that can
+// report per-container resource usage.
+type MetricsSource interface {
+	// Stream starts feeding Samples for cid on the returned channel. The
+	// channel is closed when ctx is cancelled or the source gives up on
+	// cid (e.g. the container went away).
+	Stream(ctx context.Context, cid string) (<-chan Sample, error)
+
+	// Close releases any resources held by the source (connections,
+	// watches, ...). Stream must not be called after Close.
+	Close() error
+}
+
+// newMetricsSource picks a MetricsSource implementation based on
+// asg.Driver, defaulting to the controller HTTP API so existing
+// configurations keep working unchanged.
+func newMetricsSource(asg *AutoScaleGroup) (MetricsSource, error) {
+	switch asg.Driver {
+	case "", "controller":
+		return newControllerSource(), nil
+	case "docker":
+		return newDockerEngineSource(asg.DockerSocket), nil
+	case "cadvisor":
+		return newCAdvisorSource(asg.CAdvisorAddr), nil
+	default:
+		return nil, fmt.Errorf("unknown metrics driver %q", asg.Driver)
+	}
+}
+
+// controllerSource reads per-container stats from the existing controller
+// HTTP endpoint, the same one this autoscaler has always used.
+type controllerSource struct{}
+
+func newControllerSource() *controllerSource {
+	return &controllerSource{}
+}
+
+func (s *controllerSource) Stream(ctx context.Context, cid string) (<-chan Sample, error) {
+	url := controllerAddr + "/api/containers/" + cid + "/stats?ApiKey=" + apiKey
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Sample)
+	go func() {
+		defer close(out)
+		defer res.Body.Close()
+
+		var last *Stat
+		var lastAt time.Time
+		r := bufio.NewReader(res.Body)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if len(line) < 100 {
+				continue
+			}
+
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			stat := &Stat{}
+			if err := json.Unmarshal([]byte(strings.TrimSpace(parts[1])), stat); err != nil {
+				return
+			}
+			now := time.Now()
+
+			if last == nil {
+				last, lastAt = stat, now
+				continue
+			}
+
+			sample := deriveSample(cid, last, stat, now.Sub(lastAt).Seconds(), now)
+			last, lastAt = stat, now
+
+			select {
+			case out <- sample:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *controllerSource) Close() error {
+	return nil
+}
+
+// cpuPercent computes CPU usage between two consecutive samples as a
+// percentage of the host's total CPU time across all cores, matching the
+// calculation the controller source has always used.
+func cpuPercent(prev, cur *Stat) float64 {
+	cpuDelta := cur.CPUStats.CPUUsage.TotalUsage - prev.CPUStats.CPUUsage.TotalUsage
+	sysDelta := cur.CPUStats.SystemCPUUsage - prev.CPUStats.SystemCPUUsage
+	if sysDelta <= 0 {
+		return 0
+	}
+	return cpuDelta * 100 / sysDelta
+}
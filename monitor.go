@@ -1,17 +1,34 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
-	"net/http"
-	"strings"
+	"context"
+	"fmt"
+	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+
+	"github.com/gotoolkits/autoscale/metrics"
 )
 
-const scaleDelay = 5
+// events fans out every scale decision this process makes, including
+// no-ops, to /events subscribers.
+var events = metrics.NewBroker()
+
+// scaleFunc is a seam over the package-level scale function so tests can
+// substitute a fake controller without an HTTP round trip.
+var scaleFunc = scale
+
+const (
+	defaultScaleOutCooldown = 60 * time.Second
+	defaultScaleInCooldown  = 300 * time.Second
+
+	// scaleTolerance is the dead band around a 1:1 ratio within which the
+	// monitor won't act, to avoid flapping on borderline load.
+	scaleTolerance = 0.1
+)
 
 type Stat struct {
 	CPUStats struct {
@@ -29,20 +46,66 @@ type Stat struct {
 		MaxUsage float64 `json:"max_usage"`
 		Usage    float64 `json:"usage"`
 	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes float64 `json:"rx_bytes"`
+		TxBytes float64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IoServiceBytesRecursive []struct {
+			Op    string  `json:"op"`
+			Value float64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+}
+
+// memPercent returns memory usage as a percentage of the container's
+// memory limit, or 0 if no limit is set.
+func (s *Stat) memPercent() float64 {
+	if s.MemoryStats.Limit == 0 {
+		return 0
+	}
+	return s.MemoryStats.Usage / s.MemoryStats.Limit * 100
+}
+
+// networkTotals sums Rx/Tx bytes across all of the container's interfaces.
+func (s *Stat) networkTotals() (rx, tx float64) {
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	return rx, tx
+}
+
+// blkioTotals sums recursive block I/O read/write bytes across all devices.
+func (s *Stat) blkioTotals() (read, write float64) {
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch e.Op {
+		case "Read":
+			read += e.Value
+		case "Write":
+			write += e.Value
+		}
+	}
+	return read, write
 }
 
 type watcher struct {
-	cid      string
-	lastStat *Stat
-	stop     chan bool
-	m        *monitor
+	cid  string
+	stop chan bool
+	m    *monitor
+
+	cpuEWMA *ewmaTracker
+	memEWMA *ewmaTracker
 }
 
 func newWatcher(cid string, m *monitor) *watcher {
+	halfLife := time.Duration(m.EWMAHalfLifeSeconds) * time.Second
 	return &watcher{
-		cid:  cid,
-		stop: make(chan bool),
-		m:    m,
+		cid:     cid,
+		stop:    make(chan bool),
+		m:       m,
+		cpuEWMA: newEWMATracker(halfLife),
+		memEWMA: newEWMATracker(halfLife),
 	}
 }
 
@@ -54,85 +117,103 @@ func (w *watcher) quit() {
 	}
 }
 
-func (w *watcher) watch() (err error) {
-	url := controllerAddr + "/api/containers/" + w.cid + "/stats?ApiKey=" + apiKey
-	res, err := http.Get(url)
+// watch pulls Samples for w.cid from the monitor's MetricsSource until the
+// source closes the channel, ctx is cancelled, or the watcher is told to
+// stop.
+func (w *watcher) watch(ctx context.Context) (err error) {
+	defer w.m.wg.Done()
+
+	samples, err := w.m.source.Stream(ctx, w.cid)
 	if err != nil {
-		return err
-	}
-	defer func() {
-		res.Body.Close()
 		w.m.evict(w.cid)
 		logrus.Errorf("watch error: %v", err)
-	}()
+		return err
+	}
 
-	r := bufio.NewReader(res.Body)
 	for {
 		select {
 		case <-w.stop:
 			return nil
-		default:
-		}
-
-		line, err := r.ReadString('\n')
-		if err != nil {
-			return err
-		}
-
-		if len(line) < 100 {
-			continue
-		}
-
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		line = strings.TrimSpace(parts[1])
-		stat := &Stat{}
-		err = json.Unmarshal([]byte(line), stat)
-		if err != nil {
-			return err
-		}
-
-		if w.lastStat == nil {
-			w.lastStat = stat
-			continue
+		case <-ctx.Done():
+			return nil
+		case sample, ok := <-samples:
+			if !ok {
+				w.m.evict(w.cid)
+				return nil
+			}
+			cpuEWMA, cpuSlope := w.cpuEWMA.update(sample.Timestamp, sample.CPUPercent)
+			memEWMA, memSlope := w.memEWMA.update(sample.Timestamp, sample.MemoryUsageBytes)
+			w.m.setMetrics(w.cid, sample, cpuEWMA, cpuSlope, memEWMA, memSlope)
 		}
-
-		cpu := (stat.CPUStats.CPUUsage.TotalUsage - w.lastStat.CPUStats.CPUUsage.TotalUsage) * 100 / (stat.CPUStats.SystemCPUUsage - w.lastStat.CPUStats.SystemCPUUsage)
-		memory := stat.MemoryStats.Usage
-		w.m.setMetrics(w.cid, cpu, memory)
-
-		w.lastStat = stat
 	}
 }
 
 type monitor struct {
 	*AutoScaleGroup
 	sync.Mutex
+	source   MetricsSource
 	watchers map[string]*watcher
-	cpu      map[string]float64
-	mem      map[string]float64
+
+	// metrics holds the latest reading per metric name per container,
+	// e.g. metrics["cpu"][cid]. Populated from the Samples the watchers
+	// pull off the MetricsSource.
+	metrics map[string]map[string]float64
 
 	// The result of the last 5 checks. 0: no scale events. 1: scale out. -1: scale in.
 	recentN []int8
+
+	lastScaleOut time.Time
+	lastScaleIn  time.Time
+
+	// wg tracks every watcher goroutine (and the container-list watcher
+	// itself) so Run can drain them on shutdown instead of leaking them.
+	wg sync.WaitGroup
 }
 
-func newMonitor(asg *AutoScaleGroup) *monitor {
+// newMonitor builds a monitor for asg. source is injected rather than
+// constructed internally so tests can supply a fake MetricsSource.
+func newMonitor(asg *AutoScaleGroup, source MetricsSource) *monitor {
 	return &monitor{
 		AutoScaleGroup: asg,
+		source:         source,
 		watchers:       make(map[string]*watcher),
-		cpu:            make(map[string]float64),
-		mem:            make(map[string]float64),
+		metrics:        make(map[string]map[string]float64),
 		recentN:        make([]int8, 0, asg.Periods),
 	}
 }
 
-func (m *monitor) watchContainersChange() {
-	for range time.Tick(time.Second) {
-		containers, err := listContainers(m.App, m.Service)
+// watchContainersChange keeps m.watchers in sync with the controller's
+// container list for m.App/m.Service. It prefers watchContainers' long-poll
+// endpoint, which returns within ~100ms of a real change, falling back to
+// once-a-second listContainers polling if the controller doesn't support
+// long-poll.
+func (m *monitor) watchContainersChange(ctx context.Context) {
+	longPoll := true
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		var containers []Container
+		var err error
+		if longPoll {
+			containers, err = watchContainers(ctx, m.App, m.Service)
+			if err == errLongPollUnsupported {
+				logrus.Debugf("controller doesn't support long-poll container watch for %s.%s, falling back to periodic polling", m.App, m.Service)
+				longPoll = false
+				continue
+			}
+		} else {
+			containers, err = listContainers(ctx, m.App, m.Service)
+		}
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			logrus.Errorf("Failed to call container list API: %v", err)
+			if !sleepOrDone(ctx, time.Second) {
+				return
+			}
 			continue
 		}
 
@@ -143,7 +224,8 @@ func (m *monitor) watchContainersChange() {
 			if _, ok := m.watchers[c.Id]; !ok {
 				// start watcher for the container
 				m.watchers[c.Id] = newWatcher(c.Id, m)
-				go m.watchers[c.Id].watch()
+				m.wg.Add(1)
+				go m.watchers[c.Id].watch(ctx)
 			}
 		}
 
@@ -153,7 +235,27 @@ func (m *monitor) watchContainersChange() {
 				m.evictUnsafe(id)
 			}
 		}
+		replicas := len(m.watchers)
 		m.Unlock()
+
+		metrics.Replicas.WithLabelValues(m.App, m.Service).Set(float64(replicas))
+
+		if !longPoll {
+			if !sleepOrDone(ctx, time.Second) {
+				return
+			}
+		}
+	}
+}
+
+// sleepOrDone waits for d, returning false early (without completing the
+// wait) if ctx is cancelled first.
+func sleepOrDone(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
 	}
 }
 
@@ -165,88 +267,204 @@ func sum(vars []int8) int {
 	return s
 }
 
-func (m *monitor) start() {
-	go m.watchContainersChange()
+// start runs the autoscaling decision loop until ctx is cancelled. It
+// returns as soon as ctx is done; it does not itself wait for in-flight
+// watcher goroutines to drain (see AutoScaleGroup.Run, which does).
+func (m *monitor) start(ctx context.Context) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.watchContainersChange(ctx)
+	}()
 
 	// Wait for the stats monitor to feed data.
-	time.Sleep(time.Second * time.Duration(m.Periods))
-
-	for range time.Tick(time.Second) {
-		m.Lock()
-		logrus.Debugf("monitors count: %d", len(m.watchers))
+	if !sleepOrDone(ctx, time.Second*time.Duration(m.Periods)) {
+		return
+	}
 
-		avgMem := avg(m.mem)
-		avgCpu := avg(m.cpu)
-		if len(m.recentN) == m.Periods {
-			m.recentN = m.recentN[1:]
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.evaluateOnce(ctx)
 		}
+	}
+}
 
-		if avgCpu >= m.CpuHigh || avgMem >= m.MemoryHigh {
-			m.recentN = append(m.recentN, 1)
-		} else if avgCpu <= m.CpuLow && avgMem <= m.MemoryLow {
-			m.recentN = append(m.recentN, -1)
-		} else {
-			m.recentN = append(m.recentN, 0)
-		}
+// evaluateOnce runs a single decision loop iteration: vote, decide, and act
+// (or not), recording a Prometheus decision-latency sample and an /events
+// Event regardless of the outcome.
+func (m *monitor) evaluateOnce(ctx context.Context) {
+	start := time.Now()
+	defer func() {
+		metrics.DecisionLatency.WithLabelValues(m.App, m.Service).Observe(time.Since(start).Seconds())
+	}()
 
-		scaleOut := false
-		scaleIn := false
-		x := sum(m.recentN)
-		switch x {
-		case m.Periods:
-			scaleOut = true
-		case -1 * m.Periods:
-			scaleIn = true
-		default:
-			m.Unlock()
-			logrus.Debugf("sum: %d, cpu:%f, mem:%f, no need to scale", x, avgCpu, avgMem)
-			continue
-		}
-		m.recentN = make([]int8, 0, m.Periods)
-		currentContainers := len(m.watchers)
+	m.Lock()
+	logrus.Debugf("monitors count: %d", len(m.watchers))
+
+	metrics.GroupAverageCPU.WithLabelValues(m.App, m.Service).Set(avg(m.metrics["cpu"]))
+	metrics.GroupAverageMemory.WithLabelValues(m.App, m.Service).Set(avg(m.metrics["mem_pct"]))
+
+	predictedOut, predictedRatio := m.predictedBreachUnsafe()
+
+	anyOut, allIn := m.voteUnsafe()
+	if len(m.recentN) == m.Periods {
+		m.recentN = m.recentN[1:]
+	}
+
+	if anyOut {
+		m.recentN = append(m.recentN, 1)
+	} else if allIn {
+		m.recentN = append(m.recentN, -1)
+	} else {
+		m.recentN = append(m.recentN, 0)
+	}
+
+	scaleOut := false
+	scaleIn := false
+	x := sum(m.recentN)
+	switch {
+	case predictedOut:
+		scaleOut = true
+	case x == m.Periods:
+		scaleOut = true
+	case x == -1*m.Periods:
+		scaleIn = true
+	default:
 		m.Unlock()
+		m.noop("sum: %d, no need to scale", x)
+		return
+	}
+	m.recentN = make([]int8, 0, m.Periods)
+	currentContainers := len(m.watchers)
+	ratio := m.desiredRatioUnsafe(scaleOut)
+	if predictedOut && predictedRatio > ratio {
+		ratio = predictedRatio
+	}
+	m.Unlock()
+
+	now := time.Now()
+	if scaleOut && now.Sub(m.lastScaleOut) < m.scaleOutCooldown() {
+		m.noop("scale-out cooldown active")
+		return
+	}
+	if scaleIn && now.Sub(m.lastScaleIn) < m.scaleInCooldown() {
+		m.noop("scale-in cooldown active")
+		return
+	}
+
+	if ratio == 0 {
+		m.noop("no rule had data to size the group")
+		return
+	}
+
+	if !predictedOut && math.Abs(ratio-1) < scaleTolerance {
+		m.noop("ratio %.2f within tolerance, no need to scale", ratio)
+		return
+	}
+
+	desired := clamp(int(math.Ceil(float64(currentContainers)*ratio)), m.MinContainers, m.MaxContainers)
+	if predictedOut && desired <= currentContainers {
+		desired = clamp(currentContainers+1, m.MinContainers, m.MaxContainers)
+	}
+	if desired == currentContainers {
+		m.noop("desired %d == current %d, no need to scale", desired, currentContainers)
+		return
+	}
+
+	action := "scale_out"
+	if desired < currentContainers {
+		action = "scale_in"
+	}
+
+	if err := scaleFunc(ctx, m.App, m.Service, desired); err != nil {
+		logrus.Errorf("Failed to scale %s.%s from %d to %d: %v", m.App, m.Service, currentContainers, desired, err)
+		metrics.ScaleErrorsTotal.WithLabelValues(m.App, m.Service).Inc()
+		events.Publish(metrics.Event{App: m.App, Service: m.Service, Action: action, Reason: err.Error(), From: currentContainers, To: desired, At: now})
+		return
+	}
+
+	logrus.Infof("Scaled %s.%s from %d to %d containers", m.App, m.Service, currentContainers, desired)
+	if action == "scale_out" {
+		m.lastScaleOut = now
+		metrics.ScaleOutTotal.WithLabelValues(m.App, m.Service).Inc()
+	} else {
+		m.lastScaleIn = now
+		metrics.ScaleInTotal.WithLabelValues(m.App, m.Service).Inc()
+	}
+	events.Publish(metrics.Event{App: m.App, Service: m.Service, Action: action, Reason: "threshold crossed", From: currentContainers, To: desired, At: now})
+}
 
-		if scaleIn && currentContainers <= m.MinContainers {
-			logrus.Debugf("containers limit(less than %d) reached", m.MinContainers)
+// noop records a no-op decision: logged today via logrus.Debug and now
+// also published on /events so operators can see it without log access.
+func (m *monitor) noop(format string, args ...interface{}) {
+	reason := fmt.Sprintf(format, args...)
+	logrus.Debug(reason)
+	events.Publish(metrics.Event{App: m.App, Service: m.Service, Action: "noop", Reason: reason, At: time.Now()})
+}
+
+func (m *monitor) scaleOutCooldown() time.Duration {
+	if m.ScaleOutCooldown <= 0 {
+		return defaultScaleOutCooldown
+	}
+	return time.Duration(m.ScaleOutCooldown) * time.Second
+}
+
+func (m *monitor) scaleInCooldown() time.Duration {
+	if m.ScaleInCooldown <= 0 {
+		return defaultScaleInCooldown
+	}
+	return time.Duration(m.ScaleInCooldown) * time.Second
+}
+
+// desiredRatioUnsafe returns the highest value-to-threshold ratio across the
+// rules, against High when scaling out and Low when scaling in, e.g. 1.5
+// means "50% over". A
+// ratio of 0 means no rule had data to vote on. Callers must hold m.Lock.
+func (m *monitor) desiredRatioUnsafe(scaleOut bool) float64 {
+	var ratio float64
+	for _, rule := range m.rules() {
+		threshold := rule.High
+		if !scaleOut {
+			threshold = rule.Low
+		}
+		if threshold <= 0 {
 			continue
 		}
-
-		if scaleOut && currentContainers >= m.MaxContainers {
-			logrus.Debugf("containers limit(more than %d) reached", m.MaxContainers)
+		values := m.metrics[rule.Metric]
+		if len(values) == 0 {
 			continue
 		}
-
-		if scaleOut {
-			n := currentContainers + 1
-			if n > m.MaxContainers {
-				n = m.MaxContainers
-			}
-			if err := scale(m.App, m.Service, n); err != nil {
-				logrus.Errorf("Failed to scale out %s.%s: %v", m.App, m.Service, err)
-			} else {
-				logrus.Infof("Added 1 new container to %s.%s", m.App, m.Service)
-			}
-		} else if scaleIn {
-			if err := scale(m.App, m.Service, currentContainers-1); err != nil {
-				logrus.Errorf("Failed to scale in %s.%s: %v", m.App, m.Service, err)
-			} else {
-				logrus.Infof("Deleted 1 container from %s.%s", m.App, m.Service)
-			}
+		if r := aggregate(values, rule.Aggregation) / threshold; r > ratio {
+			ratio = r
 		}
 	}
+	return ratio
 }
 
-func (m *monitor) evictUnsafe(cid string) {
-	if _, ok := m.mem[cid]; ok {
-		delete(m.mem, cid)
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
 	}
-	if _, ok := m.cpu[cid]; ok {
-		delete(m.cpu, cid)
+	if n > max {
+		return max
+	}
+	return n
+}
+
+func (m *monitor) evictUnsafe(cid string) {
+	for _, values := range m.metrics {
+		delete(values, cid)
 	}
 	if _, ok := m.watchers[cid]; ok {
 		m.watchers[cid].quit()
 		delete(m.watchers, cid)
 	}
+	metrics.EvictContainer(m.App, m.Service, cid)
 }
 
 func (m *monitor) evict(cid string) {
@@ -255,11 +473,130 @@ func (m *monitor) evict(cid string) {
 	m.Unlock()
 }
 
-func (m *monitor) setMetrics(cid string, cpu, mem float64) {
+// setMetrics records the latest Sample for cid under every metric name it
+// carries a value for, plus the container's current CPU/memory EWMA and
+// fitted slope (per second) used by the predictive scale-out check. The
+// memory EWMA tracks mem_bytes rather than mem_pct so it stays in the same
+// unit as MemoryHigh/MemoryLow.
+func (m *monitor) setMetrics(cid string, s Sample, cpuEWMA, cpuSlope, memEWMA, memSlope float64) {
 	m.Lock()
-	m.cpu[cid] = cpu
-	m.mem[cid] = mem
+	m.setMetricUnsafe("cpu", cid, s.CPUPercent)
+	m.setMetricUnsafe("mem_pct", cid, s.MemPercent)
+	m.setMetricUnsafe("mem_bytes", cid, s.MemoryUsageBytes)
+	m.setMetricUnsafe("net_rx_bps", cid, s.NetRxBps)
+	m.setMetricUnsafe("net_tx_bps", cid, s.NetTxBps)
+	m.setMetricUnsafe("blk_read_bps", cid, s.BlkReadBps)
+	m.setMetricUnsafe("blk_write_bps", cid, s.BlkWriteBps)
+	m.setMetricUnsafe("cpu_ewma", cid, cpuEWMA)
+	m.setMetricUnsafe("cpu_slope", cid, cpuSlope)
+	m.setMetricUnsafe("mem_bytes_ewma", cid, memEWMA)
+	m.setMetricUnsafe("mem_bytes_slope", cid, memSlope)
 	m.Unlock()
+
+	metrics.ContainerCPU.WithLabelValues(m.App, m.Service, cid).Set(s.CPUPercent)
+	metrics.ContainerMemory.WithLabelValues(m.App, m.Service, cid).Set(s.MemPercent)
+}
+
+func (m *monitor) setMetricUnsafe(metric, cid string, value float64) {
+	values, ok := m.metrics[metric]
+	if !ok {
+		values = make(map[string]float64)
+		m.metrics[metric] = values
+	}
+	values[cid] = value
+}
+
+// rules returns the ScaleRules to vote on, falling back to a cpu/mem_bytes
+// pair built from CpuHigh/CpuLow/MemoryHigh/MemoryLow when the group has
+// none configured explicitly. The fallback compares against mem_bytes, not
+// mem_pct, since MemoryHigh/MemoryLow predate the mem_pct metric and are
+// expressed in raw bytes; configs that want a percentage threshold instead
+// should set an explicit ScaleRule with Metric: "mem_pct".
+func (m *monitor) rules() []ScaleRule {
+	if len(m.ScaleRules) > 0 {
+		return m.ScaleRules
+	}
+	return []ScaleRule{
+		{Metric: "cpu", High: m.CpuHigh, Low: m.CpuLow},
+		{Metric: "mem_bytes", High: m.MemoryHigh, Low: m.MemoryLow},
+	}
+}
+
+// voteUnsafe evaluates every scale rule against the latest metrics. It
+// scales out if ANY rule crosses its high threshold, and only votes to
+// scale in if ALL rules that have a Low threshold configured are under it;
+// a rule with Low <= 0 abstains from the scale-in vote instead of vetoing
+// it. Callers must hold m.Lock.
+func (m *monitor) voteUnsafe() (out bool, in bool) {
+	in = true
+	for _, rule := range m.rules() {
+		values := m.metrics[rule.Metric]
+		haveData := len(values) > 0
+		var v float64
+		if haveData {
+			v = aggregate(values, rule.Aggregation)
+		}
+
+		if rule.High > 0 && haveData && v >= rule.High {
+			out = true
+		}
+
+		if rule.Low <= 0 {
+			continue
+		}
+		if !haveData || v > rule.Low {
+			in = false
+		}
+	}
+	return out, in
+}
+
+// predictedBreachUnsafe projects each container's CPU/memory EWMA forward
+// by LeadTimeSeconds using its fitted slope and reports whether the
+// projection crosses CpuHigh/MemoryHigh, along with how far over (e.g. 1.5
+// means "projected 50% over"). It's a fallback-safe no-op when
+// LeadTimeSeconds is 0, keeping the sustained-breach path as the only
+// trigger unless prediction is explicitly enabled. Callers must hold
+// m.Lock.
+func (m *monitor) predictedBreachUnsafe() (breach bool, ratio float64) {
+	if m.LeadTimeSeconds <= 0 {
+		return false, 0
+	}
+	lead := float64(m.LeadTimeSeconds)
+
+	checks := []struct {
+		high        float64
+		ewma, slope map[string]float64
+	}{
+		{m.CpuHigh, m.metrics["cpu_ewma"], m.metrics["cpu_slope"]},
+		{m.MemoryHigh, m.metrics["mem_bytes_ewma"], m.metrics["mem_bytes_slope"]},
+	}
+	for _, c := range checks {
+		if c.high <= 0 {
+			continue
+		}
+		for cid, ewma := range c.ewma {
+			projected := ewma + c.slope[cid]*lead
+			if r := projected / c.high; r >= 1 && r > ratio {
+				breach = true
+				ratio = r
+			}
+		}
+	}
+	return breach, ratio
+}
+
+// aggregate reduces per-container values to a single number using how,
+// one of "avg" (default), "p95", or "max".
+func aggregate(values map[string]float64, how string) float64 {
+	switch how {
+	case "max":
+		return maxOf(values)
+	case "p95":
+		return percentile(values, 0.95)
+	default:
+		return avg(values)
+	}
 }
 
 func avg(m map[string]float64) float64 {
@@ -269,3 +606,26 @@ func avg(m map[string]float64) float64 {
 	}
 	return r / float64(len(m))
 }
+
+func maxOf(m map[string]float64) float64 {
+	var r float64
+	first := true
+	for _, v := range m {
+		if first || v > r {
+			r, first = v, false
+		}
+	}
+	return r
+}
+
+// percentile returns the p-th percentile (0..1) of m's values: the sorted
+// value at index floor(p*(n-1)), without interpolation.
+func percentile(m map[string]float64, p float64) float64 {
+	values := make([]float64, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	sort.Float64s(values)
+	idx := int(p * float64(len(values)-1))
+	return values[idx]
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// fakeSource is a MetricsSource that hands back a channel the test controls
+// directly, so monitor behavior can be exercised without a real controller,
+// Docker socket, or cAdvisor endpoint.
+type fakeSource struct {
+	mu      sync.Mutex
+	streams map[string]chan Sample
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{streams: make(map[string]chan Sample)}
+}
+
+func (f *fakeSource) Stream(ctx context.Context, cid string) (<-chan Sample, error) {
+	ch := make(chan Sample, 8)
+	f.mu.Lock()
+	f.streams[cid] = ch
+	f.mu.Unlock()
+	return ch, nil
+}
+
+func (f *fakeSource) Close() error { return nil }
+
+func newTestMonitor(asg *AutoScaleGroup) *monitor {
+	return newMonitor(asg, newFakeSource())
+}
+
+func TestVoteUnsafeScalesOutOnAnyRuleOverHigh(t *testing.T) {
+	m := newTestMonitor(&AutoScaleGroup{CpuHigh: 80, CpuLow: 10, MemoryHigh: 1000, MemoryLow: 100})
+	m.setMetricUnsafe("cpu", "c1", 90)
+	m.setMetricUnsafe("mem_bytes", "c1", 10)
+
+	out, in := m.voteUnsafe()
+	if !out {
+		t.Fatalf("expected scale-out vote with cpu over CpuHigh")
+	}
+	if in {
+		t.Fatalf("expected not all-in vote with cpu over CpuHigh")
+	}
+}
+
+func TestVoteUnsafeScalesInOnlyWhenEveryRuleIsUnderLow(t *testing.T) {
+	m := newTestMonitor(&AutoScaleGroup{CpuHigh: 80, CpuLow: 10, MemoryHigh: 1000, MemoryLow: 100})
+	m.setMetricUnsafe("cpu", "c1", 5)
+	m.setMetricUnsafe("mem_bytes", "c1", 5)
+
+	_, in := m.voteUnsafe()
+	if !in {
+		t.Fatalf("expected all-in vote when every rule is under its low threshold")
+	}
+}
+
+func TestVoteUnsafeRuleWithoutLowAbstainsFromScaleIn(t *testing.T) {
+	m := newTestMonitor(&AutoScaleGroup{
+		ScaleRules: []ScaleRule{
+			{Metric: "cpu", High: 80, Low: 10},
+			{Metric: "blk_write_bps", High: 1e7}, // no Low: must not veto scale-in
+		},
+	})
+	m.setMetricUnsafe("cpu", "c1", 5)
+	m.setMetricUnsafe("blk_write_bps", "c1", 5e6)
+
+	_, in := m.voteUnsafe()
+	if !in {
+		t.Fatalf("a rule with Low <= 0 should abstain from the scale-in vote, not veto it")
+	}
+}
+
+func TestDesiredRatioUnsafeScalesProportionally(t *testing.T) {
+	m := newTestMonitor(&AutoScaleGroup{CpuHigh: 50, CpuLow: 10, MemoryHigh: 1000, MemoryLow: 100})
+	m.setMetricUnsafe("cpu", "c1", 100) // 2x over CpuHigh
+
+	if ratio := m.desiredRatioUnsafe(true); ratio < 1.99 || ratio > 2.01 {
+		t.Fatalf("expected ratio ~2.0, got %v", ratio)
+	}
+}
+
+func TestPredictedBreachUnsafeReturnsProjectedRatio(t *testing.T) {
+	m := newTestMonitor(&AutoScaleGroup{CpuHigh: 80, LeadTimeSeconds: 10})
+	m.setMetricUnsafe("cpu_ewma", "c1", 50)
+	m.setMetricUnsafe("cpu_slope", "c1", 5) // projected: 50 + 5*10 = 100, 100/80 = 1.25
+
+	breach, ratio := m.predictedBreachUnsafe()
+	if !breach {
+		t.Fatalf("expected a predicted breach")
+	}
+	if ratio < 1.24 || ratio > 1.26 {
+		t.Fatalf("expected predicted ratio ~1.25, got %v", ratio)
+	}
+}
+
+func TestEvaluateOnceScalesOutAheadOfRawThresholdOnPredictedBreach(t *testing.T) {
+	asg := &AutoScaleGroup{
+		App: "app", Service: "svc",
+		Periods:         3,
+		CpuHigh:         80,
+		CpuLow:          10,
+		MinContainers:   1,
+		MaxContainers:   10,
+		LeadTimeSeconds: 10,
+	}
+	m := newTestMonitor(asg)
+	m.watchers["c1"] = &watcher{cid: "c1"}
+	m.setMetricUnsafe("cpu", "c1", 50) // raw average is well under CpuHigh
+	m.setMetricUnsafe("cpu_ewma", "c1", 50)
+	m.setMetricUnsafe("cpu_slope", "c1", 5) // but projected to breach within LeadTimeSeconds
+
+	var scaledTo int
+	orig := scaleFunc
+	scaleFunc = func(ctx context.Context, app, service string, n int) error {
+		scaledTo = n
+		return nil
+	}
+	defer func() { scaleFunc = orig }()
+
+	m.evaluateOnce(context.Background())
+
+	if scaledTo <= 1 {
+		t.Fatalf("expected the predictive path to scale out beyond the current size, got %d", scaledTo)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Container is a single running container as reported by the controller's
+// container-list API.
+type Container struct {
+	Id string `json:"Id"`
+}
+
+// AutoScaleGroup describes the scaling policy for one app/service pair.
+type AutoScaleGroup struct {
+	App     string
+	Service string
+
+	Periods int
+
+	CpuHigh float64
+	CpuLow  float64
+
+	// MemoryHigh/MemoryLow are raw memory usage in bytes, compared against
+	// the mem_bytes metric. They predate the mem_pct metric; groups that
+	// want a percentage-of-limit threshold instead should set an explicit
+	// ScaleRule with Metric: "mem_pct".
+	MemoryHigh float64
+	MemoryLow  float64
+
+	MinContainers int
+	MaxContainers int
+
+	// Driver selects which MetricsSource feeds this group's monitor.
+	// One of "controller" (default), "docker", or "cadvisor".
+	Driver string
+
+	// DockerSocket is the UNIX socket path used by the "docker" driver.
+	// Defaults to /var/run/docker.sock when empty.
+	DockerSocket string
+
+	// CAdvisorAddr is the base URL (e.g. http://localhost:8080) used by
+	// the "cadvisor" driver.
+	CAdvisorAddr string
+
+	// ScaleRules lists the signals the monitor votes on each period. When
+	// empty, the monitor falls back to a cpu/mem_bytes pair built from
+	// CpuHigh/CpuLow/MemoryHigh/MemoryLow so existing configs keep working.
+	ScaleRules []ScaleRule
+
+	// ScaleOutCooldown/ScaleInCooldown are the minimum number of seconds
+	// to wait after a scale action before acting again in the same
+	// direction. Zero means use the package defaults (60s/300s).
+	ScaleOutCooldown int
+	ScaleInCooldown  int
+
+	// EWMAHalfLifeSeconds is the half-life of the CPU/memory exponential
+	// moving averages computed per container. Zero means use the package
+	// default (30s).
+	EWMAHalfLifeSeconds int
+
+	// LeadTimeSeconds enables predictive scale-out: when greater than 0,
+	// the monitor projects each EWMA forward by this many seconds using
+	// its fitted slope and scales out immediately if the projection
+	// crosses CpuHigh/MemoryHigh, without waiting for Periods consecutive
+	// sustained-breach samples. Zero (the default) disables prediction
+	// and keeps the sustained-breach path as the only trigger.
+	LeadTimeSeconds int
+}
+
+// ScaleRule names one metric the monitor aggregates across a group's
+// containers and votes to scale out/in on.
+type ScaleRule struct {
+	// Metric is one of "cpu", "mem_pct", "mem_bytes", "net_rx_bps",
+	// "net_tx_bps", "blk_read_bps", "blk_write_bps".
+	Metric string
+
+	High float64
+
+	// Low is the scale-in threshold. A rule with Low <= 0 still
+	// participates in the scale-out vote (via High) but abstains from the
+	// scale-in vote entirely, rather than permanently vetoing it.
+	Low float64
+
+	// Aggregation is one of "avg" (default), "p95", or "max".
+	Aggregation string
+}
+
+var (
+	controllerAddr string
+	apiKey         string
+)
+
+const (
+	// pollTimeout bounds a single ordinary (non-long-poll) controller
+	// request.
+	pollTimeout = 10 * time.Second
+
+	// longPollWait is how long we ask the controller to hold a
+	// containers/watch request open for before returning the current
+	// state unchanged.
+	longPollWait = 25 * time.Second
+
+	// longPollTimeout is the client-side timeout for a long-poll request;
+	// it must exceed longPollWait to give the server room to respond.
+	longPollTimeout = 35 * time.Second
+)
+
+var (
+	pollClient     = &http.Client{Timeout: pollTimeout}
+	longPollClient = &http.Client{Timeout: longPollTimeout}
+)
+
+// errLongPollUnsupported is returned by watchContainers when the
+// controller doesn't implement the long-poll endpoint, so callers can fall
+// back to plain listContainers polling.
+var errLongPollUnsupported = errors.New("controller does not support long-poll container watch")
+
+// listContainers asks the controller which containers currently belong to
+// app.service.
+func listContainers(ctx context.Context, app, service string) ([]Container, error) {
+	url := fmt.Sprintf("%s/api/apps/%s/services/%s/containers?ApiKey=%s", controllerAddr, app, service, apiKey)
+	return doListContainers(ctx, pollClient, url)
+}
+
+// watchContainers long-polls the controller for up to longPollWait
+// seconds, returning as soon as the container list for app.service
+// changes (or the wait elapses). It returns errLongPollUnsupported if the
+// controller doesn't implement this endpoint, so the caller can fall back
+// to periodic listContainers polling.
+func watchContainers(ctx context.Context, app, service string) ([]Container, error) {
+	url := fmt.Sprintf("%s/api/apps/%s/services/%s/containers/watch?ApiKey=%s&wait=%d",
+		controllerAddr, app, service, apiKey, int(longPollWait.Seconds()))
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := longPollClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, errLongPollUnsupported
+	}
+	return decodeContainers(res)
+}
+
+func doListContainers(ctx context.Context, client *http.Client, url string) ([]Container, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return decodeContainers(res)
+}
+
+func decodeContainers(res *http.Response) ([]Container, error) {
+	defer res.Body.Close()
+	var containers []Container
+	if err := json.NewDecoder(res.Body).Decode(&containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// scale asks the controller to resize app.service to n containers.
+func scale(ctx context.Context, app, service string, n int) error {
+	url := fmt.Sprintf("%s/api/apps/%s/services/%s/scale?ApiKey=%s", controllerAddr, app, service, apiKey)
+	body, err := json.Marshal(struct {
+		Count int `json:"Count"`
+	}{n})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := pollClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("scale %s.%s to %d: unexpected status %s", app, service, n, res.Status)
+	}
+	return nil
+}
+
+// Run blocks serving asg's autoscaling loop until ctx is cancelled, then
+// waits for all in-flight container watchers to drain before returning.
+func (asg *AutoScaleGroup) Run(ctx context.Context) error {
+	source, err := newMetricsSource(asg)
+	if err != nil {
+		return err
+	}
+
+	m := newMonitor(asg, source)
+	m.start(ctx)
+	m.wg.Wait()
+
+	return source.Close()
+}